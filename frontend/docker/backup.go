@@ -0,0 +1,294 @@
+package docker
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/netapp/trident/core"
+	"github.com/netapp/trident/storage"
+)
+
+// backupManifestVersion identifies the layout of the JSON manifest bundled
+// with every backup so that future versions of this frontend can tell
+// whether they know how to restore an older backup.
+const backupManifestVersion = 1
+
+// backupManifest describes a volume well enough to recreate an equivalent
+// one elsewhere.  It travels alongside the volume's data in every backup,
+// whether that backup is a tar stream or an optimized backend-native
+// transfer.
+type backupManifest struct {
+	Version             int               `json:"version"`
+	VolumeName          string            `json:"volumeName"`
+	SizeBytes           string            `json:"sizeBytes"`
+	FileSystem          string            `json:"fileSystem"`
+	Protocol            string            `json:"protocol"`
+	CloneSourceVolume   string            `json:"cloneSourceVolume,omitempty"`
+	CloneSourceSnapshot string            `json:"cloneSourceSnapshot,omitempty"`
+	StorageClassOptions map[string]string `json:"storageClassOptions"`
+	// OptimizedStorage records whether the data was written via a
+	// backend-native snapshot transfer rather than a tar stream, so restore
+	// knows which path to rehydrate with.
+	OptimizedStorage bool `json:"optimizedStorage"`
+}
+
+// backupTarget is a destination (or source) for backup data.  Implementations
+// exist for a local tarball path, an S3 URL, and an NFS export; callers pick
+// one based on the scheme of the --target URI.
+type backupTarget interface {
+	// WriteManifest persists the manifest describing the volume being backed up.
+	WriteManifest(manifest *backupManifest) error
+	// WriteData streams the volume's snapshot contents to the target.
+	WriteData(volumeConfig *storage.VolumeConfig) error
+	// ReadManifest retrieves the manifest for a previously written backup.
+	ReadManifest() (*backupManifest, error)
+	// ReadData rehydrates the volume's contents from the target.
+	ReadData(volumeConfig *storage.VolumeConfig) error
+}
+
+// newBackupTarget parses a --target URI and returns the backupTarget that
+// handles it: a local tarball path, an s3:// URL, or an nfs:// export.
+func newBackupTarget(targetURI string) (backupTarget, error) {
+
+	u, err := url.Parse(targetURI)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backup target %q: %v", targetURI, err)
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "", "file":
+		return &localBackupTarget{path: u.Path}, nil
+	case "s3":
+		region := u.Query().Get("region")
+		if region == "" {
+			region = os.Getenv("AWS_REGION")
+		}
+		return &s3BackupTarget{url: u, region: region}, nil
+	case "nfs":
+		return &nfsBackupTarget{url: u}, nil
+	default:
+		return nil, fmt.Errorf("unsupported backup target scheme %q", u.Scheme)
+	}
+}
+
+// createBackup takes a consistent snapshot of sourceVolume via the backend
+// and streams it, along with a manifest describing how to recreate an
+// equivalent volume, to the given target.  When optimizedStorage is true, the
+// data is handed to the orchestrator's BackupVolumeNative for a
+// backend-native snapshot transfer and no tar stream is written; this
+// function does not check whether the source and target backend are the same.
+func createBackup(
+	o core.Orchestrator, sourceVolume, targetURI string, optimizedStorage bool,
+) error {
+
+	target, err := newBackupTarget(targetURI)
+	if err != nil {
+		return err
+	}
+
+	vol := o.GetVolume(sourceVolume)
+	if vol == nil {
+		return fmt.Errorf("volume %s not found", sourceVolume)
+	}
+
+	manifest := &backupManifest{
+		Version:             backupManifestVersion,
+		VolumeName:          vol.Config.Name,
+		SizeBytes:           vol.Config.Size,
+		FileSystem:          vol.Config.FileSystem,
+		Protocol:            string(vol.Config.Protocol),
+		CloneSourceVolume:   vol.Config.CloneSourceVolume,
+		CloneSourceSnapshot: vol.Config.CloneSourceSnapshot,
+		StorageClassOptions: storageClassOptionsOf(vol.Config),
+		OptimizedStorage:    optimizedStorage,
+	}
+
+	if err = target.WriteManifest(manifest); err != nil {
+		return fmt.Errorf("error writing backup manifest for %s: %v", sourceVolume, err)
+	}
+
+	if optimizedStorage {
+		if err = o.BackupVolumeNative(sourceVolume, targetURI); err != nil {
+			return fmt.Errorf("error performing optimized backup of %s: %v", sourceVolume, err)
+		}
+		return nil
+	}
+
+	// Take a transient, point-in-time snapshot of the source and clone from
+	// it rather than reading the volume's live mount point directly, so a
+	// volume being actively written to doesn't produce a crash-inconsistent
+	// backup. The clone (and, on success, the snapshot) are removed once the
+	// data has been streamed.
+	snapshotName := fmt.Sprintf("backup-%s", vol.Config.Name)
+	if err = o.CreateSnapshot(sourceVolume, snapshotName); err != nil {
+		return fmt.Errorf("error snapshotting %s for backup: %v", sourceVolume, err)
+	}
+
+	cloneConfig := &storage.VolumeConfig{
+		Name:                fmt.Sprintf("%s-backup-clone", vol.Config.Name),
+		Size:                vol.Config.Size,
+		Protocol:            vol.Config.Protocol,
+		AccessMode:          vol.Config.AccessMode,
+		FileSystem:          vol.Config.FileSystem,
+		CloneSourceVolume:   sourceVolume,
+		CloneSourceSnapshot: snapshotName,
+		CloneStrategy:       "snapshot",
+	}
+	clone, err := o.AddVolume(cloneConfig)
+	if err != nil {
+		return fmt.Errorf("error cloning %s for backup: %v", sourceVolume, err)
+	}
+
+	if err = target.WriteData(clone.Config); err != nil {
+		if delErr := o.DeleteVolume(cloneConfig.Name); delErr != nil {
+			log.Error("Docker frontend couldn't remove backup clone volume: ", delErr)
+		}
+		return fmt.Errorf("error streaming backup data for %s: %v", sourceVolume, err)
+	}
+
+	if err = o.DeleteVolume(cloneConfig.Name); err != nil {
+		log.Error("Docker frontend couldn't remove backup clone volume: ", err)
+	}
+	if err = o.DeleteSnapshot(sourceVolume, snapshotName); err != nil {
+		log.Error("Docker frontend couldn't remove backup snapshot: ", err)
+	}
+
+	log.WithFields(log.Fields{
+		"volume": sourceVolume,
+		"target": targetURI,
+	}).Info("Docker frontend created volume backup.")
+
+	return nil
+}
+
+// restoreBackup reads the manifest at targetURI, provisions a new volume
+// named newVolume with an equivalent storage class, and rehydrates its
+// contents from the backup.
+func restoreBackup(o core.Orchestrator, targetURI, newVolume string) error {
+
+	target, err := newBackupTarget(targetURI)
+	if err != nil {
+		return err
+	}
+
+	manifest, err := target.ReadManifest()
+	if err != nil {
+		return fmt.Errorf("error reading backup manifest at %s: %v", targetURI, err)
+	}
+	if manifest.Version != backupManifestVersion {
+		return fmt.Errorf("unsupported backup manifest version %d", manifest.Version)
+	}
+
+	scConfig, err := makeStorageClass(manifest.StorageClassOptions, o)
+	if err != nil {
+		return fmt.Errorf("error recreating storage class for %s: %v", newVolume, err)
+	}
+	sc := o.GetStorageClass(scConfig.Name)
+	if sc == nil {
+		if sc, err = o.AddStorageClass(scConfig); err != nil {
+			return fmt.Errorf("error registering storage class for %s: %v", newVolume, err)
+		}
+	}
+
+	volumeConfig, err := getVolumeConfig(newVolume, sc.Config.Name, manifest.StorageClassOptions)
+	if err != nil {
+		return fmt.Errorf("error building volume config for %s: %v", newVolume, err)
+	}
+	volumeConfig.Size = manifest.SizeBytes
+	volumeConfig.FileSystem = manifest.FileSystem
+
+	// manifest.CloneSourceVolume/CloneSourceSnapshot describe where the
+	// backed-up data originally came from; they are informational only and
+	// must not be copied onto the restored volume's config. Setting them
+	// here would tell the orchestrator to provision newVolume as a clone of
+	// the *original* source, which won't even exist on a cross-system
+	// restore, instead of a plain volume to be rehydrated from the backup.
+
+	if _, err = o.AddVolume(volumeConfig); err != nil {
+		return fmt.Errorf("error provisioning restored volume %s: %v", newVolume, err)
+	}
+
+	if manifest.OptimizedStorage {
+		if err = o.RestoreVolumeNative(newVolume, targetURI); err != nil {
+			return fmt.Errorf("error performing optimized restore of %s: %v", newVolume, err)
+		}
+	} else {
+		if err = target.ReadData(volumeConfig); err != nil {
+			return fmt.Errorf("error rehydrating restored volume %s: %v", newVolume, err)
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"volume": newVolume,
+		"target": targetURI,
+	}).Info("Docker frontend restored volume from backup.")
+
+	return nil
+}
+
+// handleBackupOption inspects a Docker volume-create request's opts for the
+// backup/restore keys (backup, backupTarget, optimizedStorage) and, if
+// present, performs the requested operation instead of a normal volume
+// create.  It returns true if opts requested a backup operation, in which
+// case the caller should not go on to provision name as an ordinary volume.
+func handleBackupOption(o core.Orchestrator, name string, opts map[string]string) (bool, error) {
+
+	op := opts["backup"]
+	if op == "" {
+		return false, nil
+	}
+
+	target := opts["backupTarget"]
+	if target == "" {
+		return true, fmt.Errorf("backup requires a backupTarget option")
+	}
+	optimizedStorage := opts["optimizedStorage"] == "true"
+
+	switch op {
+	case "create":
+		return true, createBackup(o, name, target, optimizedStorage)
+	case "restore":
+		return true, restoreBackup(o, target, name)
+	default:
+		return true, fmt.Errorf("unsupported backup operation %q", op)
+	}
+}
+
+// storageClassOptionsOf recovers the Docker volume-creation options implied
+// by a volume's config, so a restored volume can be recreated with an
+// equivalent storage class.
+func storageClassOptionsOf(c *storage.VolumeConfig) map[string]string {
+	options := make(map[string]string)
+	if c.SpaceReserve != "" {
+		options["spaceReserve"] = c.SpaceReserve
+	}
+	if c.SecurityStyle != "" {
+		options["securityStyle"] = c.SecurityStyle
+	}
+	if c.SnapshotPolicy != "" {
+		options["snapshotPolicy"] = c.SnapshotPolicy
+	}
+	if c.ExportPolicy != "" {
+		options["exportPolicy"] = c.ExportPolicy
+	}
+	if c.UnixPermissions != "" {
+		options["unixPermissions"] = c.UnixPermissions
+	}
+	if c.BlockSize != "" {
+		options["blocksize"] = c.BlockSize
+	}
+	if c.Encryption != "" {
+		options["encryption"] = c.Encryption
+	}
+	if c.CloneStrategy != "" {
+		options["cloneStrategy"] = c.CloneStrategy
+	}
+	if c.SnapshotClass != "" {
+		options["snapshotClass"] = c.SnapshotClass
+	}
+	return options
+}
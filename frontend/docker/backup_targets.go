@@ -0,0 +1,405 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/netapp/trident/storage"
+)
+
+const backupManifestFileName = "manifest.json"
+
+// localBackupTarget implements backupTarget against a local filesystem path,
+// writing a tar stream of the volume's contents to a single tarball at that
+// path and the manifest to a sibling file named <path>.manifest.json.
+type localBackupTarget struct {
+	path string
+}
+
+func (t *localBackupTarget) WriteManifest(manifest *backupManifest) error {
+	if err := os.MkdirAll(filepath.Dir(t.path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(t.manifestPath())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(manifest)
+}
+
+func (t *localBackupTarget) WriteData(volumeConfig *storage.VolumeConfig) error {
+	f, err := os.Create(t.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	tw := tar.NewWriter(f)
+	defer tw.Close()
+
+	return streamVolumeToTar(volumeConfig, tw)
+}
+
+func (t *localBackupTarget) ReadManifest() (*backupManifest, error) {
+	f, err := os.Open(t.manifestPath())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	manifest := &backupManifest{}
+	if err = json.NewDecoder(f).Decode(manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+func (t *localBackupTarget) ReadData(volumeConfig *storage.VolumeConfig) error {
+	f, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return extractTarToVolume(volumeConfig, tar.NewReader(f))
+}
+
+func (t *localBackupTarget) manifestPath() string {
+	return t.path + "." + backupManifestFileName
+}
+
+// s3BackupTarget implements backupTarget against an s3:// URL.  The bucket
+// and key are taken from the URL's host and path; credentials come from the
+// environment (AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY/AWS_SESSION_TOKEN), as
+// with the AWS CLI, and every request is SigV4-signed.
+type s3BackupTarget struct {
+	url    *url.URL
+	region string
+}
+
+func (t *s3BackupTarget) WriteManifest(manifest *backupManifest) error {
+	body, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	return t.put(t.manifestKey(), body)
+}
+
+func (t *s3BackupTarget) WriteData(volumeConfig *storage.VolumeConfig) error {
+	pr, pw := io.Pipe()
+	tw := tar.NewWriter(pw)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- streamVolumeToTar(volumeConfig, tw)
+		tw.Close()
+		pw.Close()
+	}()
+
+	if err := t.putStream(t.dataKey(), pr); err != nil {
+		return err
+	}
+	return <-errCh
+}
+
+func (t *s3BackupTarget) ReadManifest() (*backupManifest, error) {
+	body, err := t.get(t.manifestKey())
+	if err != nil {
+		return nil, err
+	}
+	manifest := &backupManifest{}
+	if err = json.Unmarshal(body, manifest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+func (t *s3BackupTarget) ReadData(volumeConfig *storage.VolumeConfig) error {
+	req, err := http.NewRequest(http.MethodGet, t.objectURL(t.dataKey()), nil)
+	if err != nil {
+		return err
+	}
+	if err = signAWSRequest(req, sha256Hex(nil), t.region); err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("S3 GET of %s failed: %s", t.dataKey(), resp.Status)
+	}
+	return extractTarToVolume(volumeConfig, tar.NewReader(resp.Body))
+}
+
+func (t *s3BackupTarget) manifestKey() string { return t.url.Path + "/" + backupManifestFileName }
+func (t *s3BackupTarget) dataKey() string     { return t.url.Path + "/data.tar" }
+
+func (t *s3BackupTarget) objectURL(key string) string {
+	return fmt.Sprintf("https://%s.s3.amazonaws.com%s", t.url.Host, key)
+}
+
+func (t *s3BackupTarget) put(key string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPut, t.objectURL(key), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if err = signAWSRequest(req, sha256Hex(body), t.region); err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("S3 PUT of %s failed: %s", key, resp.Status)
+	}
+	return nil
+}
+
+// putStream signs and PUTs a streamed body. The payload can't be hashed up
+// front without buffering it, so it is signed as UNSIGNED-PAYLOAD, which S3
+// accepts for SigV4 requests whose body isn't known ahead of time.
+func (t *s3BackupTarget) putStream(key string, r io.Reader) error {
+	req, err := http.NewRequest(http.MethodPut, t.objectURL(key), r)
+	if err != nil {
+		return err
+	}
+	if err = signAWSRequest(req, "UNSIGNED-PAYLOAD", t.region); err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("S3 PUT of %s failed: %s", key, resp.Status)
+	}
+	return nil
+}
+
+func (t *s3BackupTarget) get(key string) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, t.objectURL(key), nil)
+	if err != nil {
+		return nil, err
+	}
+	if err = signAWSRequest(req, sha256Hex(nil), t.region); err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("S3 GET of %s failed: %s", key, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// nfsBackupTarget implements backupTarget against an already-mounted NFS
+// export, addressed as nfs://host/export/path.  The export is expected to be
+// mounted at the local path carried in the URL's path component.
+type nfsBackupTarget struct {
+	url *url.URL
+}
+
+func (t *nfsBackupTarget) local() *localBackupTarget {
+	return &localBackupTarget{path: filepath.Join(t.url.Path, "data.tar")}
+}
+
+func (t *nfsBackupTarget) WriteManifest(manifest *backupManifest) error {
+	return t.local().WriteManifest(manifest)
+}
+
+func (t *nfsBackupTarget) WriteData(volumeConfig *storage.VolumeConfig) error {
+	return t.local().WriteData(volumeConfig)
+}
+
+func (t *nfsBackupTarget) ReadManifest() (*backupManifest, error) {
+	return t.local().ReadManifest()
+}
+
+func (t *nfsBackupTarget) ReadData(volumeConfig *storage.VolumeConfig) error {
+	return t.local().ReadData(volumeConfig)
+}
+
+// streamVolumeToTar copies the contents of the volume backing volumeConfig
+// into tw by walking and reading the files under its mount point.  It does
+// not mount the volume; it assumes the volume is already accessible at its
+// mount point.
+func streamVolumeToTar(volumeConfig *storage.VolumeConfig, tw *tar.Writer) error {
+	return filepath.Walk(volumeMountPoint(volumeConfig), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(volumeMountPoint(volumeConfig), path)
+		if err != nil {
+			return err
+		}
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = rel
+		if err = tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+}
+
+// extractTarToVolume rehydrates tr into the volume backing volumeConfig.
+func extractTarToVolume(volumeConfig *storage.VolumeConfig, tr *tar.Reader) error {
+	dest := volumeMountPoint(volumeConfig)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, hdr.Name)
+		if hdr.FileInfo().IsDir() {
+			if err = os.MkdirAll(target, os.FileMode(hdr.Mode)); err != nil {
+				return err
+			}
+			continue
+		}
+		if err = os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(hdr.Mode))
+		if err != nil {
+			return err
+		}
+		if _, err = io.Copy(f, tr); err != nil {
+			f.Close()
+			return err
+		}
+		f.Close()
+	}
+}
+
+// volumeMountPoint returns the host path at which volumeConfig's volume is
+// expected to be mounted, following the Docker plugin's standard layout.
+func volumeMountPoint(volumeConfig *storage.VolumeConfig) string {
+	return filepath.Join("/var/lib/docker/plugins/trident/volumes", volumeConfig.Name)
+}
+
+// signAWSRequest adds a SigV4 Authorization header to req using the
+// AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY/AWS_SESSION_TOKEN environment
+// variables, the same credential sources the AWS CLI uses. payloadHash is
+// either the hex SHA-256 of the request body, or "UNSIGNED-PAYLOAD" for a
+// streamed body that hasn't been buffered.
+func signAWSRequest(req *http.Request, payloadHash, region string) error {
+	accessKey := os.Getenv("AWS_ACCESS_KEY_ID")
+	secretKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKey == "" || secretKey == "" {
+		return fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set to access an S3 backup target")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	dateStamp := now.Format("20060102")
+
+	req.Header.Set("host", req.URL.Host)
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+	if token := os.Getenv("AWS_SESSION_TOKEN"); token != "" {
+		req.Header.Set("x-amz-security-token", token)
+	}
+
+	signedHeaders, canonicalHeaders := canonicalizeAWSHeaders(req)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", dateStamp, region)
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	signingKey := deriveAWSSigningKey(secretKey, dateStamp, region, "s3")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+
+	return nil
+}
+
+// canonicalizeAWSHeaders builds the SignedHeaders and CanonicalHeaders
+// components of a SigV4 canonical request from the headers signAWSRequest
+// itself sets.
+func canonicalizeAWSHeaders(req *http.Request) (signedHeaders, canonicalHeaders string) {
+	names := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if req.Header.Get("x-amz-security-token") != "" {
+		names = append(names, "x-amz-security-token")
+	}
+	sort.Strings(names)
+
+	var lines []string
+	for _, name := range names {
+		lines = append(lines, name+":"+strings.TrimSpace(req.Header.Get(name)))
+	}
+	return strings.Join(names, ";"), strings.Join(lines, "\n") + "\n"
+}
+
+func deriveAWSSigningKey(secretKey, dateStamp, region, service string) []byte {
+	kDate := hmacSHA256([]byte("AWS4"+secretKey), dateStamp)
+	kRegion := hmacSHA256(kDate, region)
+	kService := hmacSHA256(kRegion, service)
+	return hmacSHA256(kService, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
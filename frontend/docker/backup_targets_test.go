@@ -0,0 +1,89 @@
+package docker
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"testing"
+)
+
+func TestSha256HexOfEmptyPayload(t *testing.T) {
+	const wantEmptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	if got := sha256Hex(nil); got != wantEmptySHA256 {
+		t.Errorf("sha256Hex(nil) = %q, want %q", got, wantEmptySHA256)
+	}
+}
+
+func TestCanonicalizeAWSHeadersOmitsTokenWhenAbsent(t *testing.T) {
+	u, _ := url.Parse("https://mybucket.s3.amazonaws.com/manifest.json")
+	req, _ := http.NewRequest(http.MethodGet, u.String(), nil)
+	req.Header.Set("host", u.Host)
+	req.Header.Set("x-amz-date", "20240101T000000Z")
+	req.Header.Set("x-amz-content-sha256", "deadbeef")
+
+	signedHeaders, _ := canonicalizeAWSHeaders(req)
+	want := "host;x-amz-content-sha256;x-amz-date"
+	if signedHeaders != want {
+		t.Errorf("signedHeaders = %q, want %q", signedHeaders, want)
+	}
+}
+
+func TestCanonicalizeAWSHeadersIncludesSecurityToken(t *testing.T) {
+	u, _ := url.Parse("https://mybucket.s3.amazonaws.com/manifest.json")
+	req, _ := http.NewRequest(http.MethodGet, u.String(), nil)
+	req.Header.Set("host", u.Host)
+	req.Header.Set("x-amz-date", "20240101T000000Z")
+	req.Header.Set("x-amz-content-sha256", "deadbeef")
+	req.Header.Set("x-amz-security-token", "sometoken")
+
+	signedHeaders, canonicalHeaders := canonicalizeAWSHeaders(req)
+	want := "host;x-amz-content-sha256;x-amz-date;x-amz-security-token"
+	if signedHeaders != want {
+		t.Errorf("signedHeaders = %q, want %q", signedHeaders, want)
+	}
+	if !containsLine(canonicalHeaders, "x-amz-security-token:sometoken") {
+		t.Errorf("canonicalHeaders missing security token line: %q", canonicalHeaders)
+	}
+}
+
+func containsLine(haystack, line string) bool {
+	for _, l := range splitLines(haystack) {
+		if l == line {
+			return true
+		}
+	}
+	return false
+}
+
+func splitLines(s string) []string {
+	var lines []string
+	start := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\n' {
+			lines = append(lines, s[start:i])
+			start = i + 1
+		}
+	}
+	if start < len(s) {
+		lines = append(lines, s[start:])
+	}
+	return lines
+}
+
+func TestSignAWSRequestRequiresCredentials(t *testing.T) {
+	oldAccessKey := os.Getenv("AWS_ACCESS_KEY_ID")
+	oldSecretKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	os.Unsetenv("AWS_ACCESS_KEY_ID")
+	os.Unsetenv("AWS_SECRET_ACCESS_KEY")
+	defer func() {
+		os.Setenv("AWS_ACCESS_KEY_ID", oldAccessKey)
+		os.Setenv("AWS_SECRET_ACCESS_KEY", oldSecretKey)
+	}()
+
+	u, _ := url.Parse("https://mybucket.s3.amazonaws.com/manifest.json")
+	req, _ := http.NewRequest(http.MethodGet, u.String(), nil)
+
+	if err := signAWSRequest(req, sha256Hex(nil), "us-east-1"); err == nil {
+		t.Error("expected an error when no AWS credentials are configured")
+	}
+}
@@ -0,0 +1,43 @@
+package docker
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestBackupManifestRoundTrip(t *testing.T) {
+	manifest := &backupManifest{
+		Version:             backupManifestVersion,
+		VolumeName:          "myvol",
+		SizeBytes:           "1073741824",
+		FileSystem:          "ext4",
+		Protocol:            "file",
+		CloneSourceVolume:   "sourcevol",
+		CloneSourceSnapshot: "backup-sourcevol",
+		StorageClassOptions: map[string]string{"spaceReserve": "none"},
+		OptimizedStorage:    true,
+	}
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	var got backupManifest
+	if err = json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	if got.OptimizedStorage != manifest.OptimizedStorage {
+		t.Errorf("OptimizedStorage = %v, want %v", got.OptimizedStorage, manifest.OptimizedStorage)
+	}
+	if got.CloneSourceVolume != manifest.CloneSourceVolume {
+		t.Errorf("CloneSourceVolume = %q, want %q", got.CloneSourceVolume, manifest.CloneSourceVolume)
+	}
+	if got.CloneSourceSnapshot != manifest.CloneSourceSnapshot {
+		t.Errorf("CloneSourceSnapshot = %q, want %q", got.CloneSourceSnapshot, manifest.CloneSourceSnapshot)
+	}
+	if got.StorageClassOptions["spaceReserve"] != "none" {
+		t.Errorf("StorageClassOptions[spaceReserve] = %q, want %q", got.StorageClassOptions["spaceReserve"], "none")
+	}
+}
@@ -0,0 +1,139 @@
+package docker
+
+import (
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/netapp/trident/core"
+)
+
+// autoStorageClassPrefix returns the static (non-format) portion of
+// auto_storage_class_prefix, used to recognize storage classes this
+// frontend created rather than ones a user defined directly.
+func autoStorageClassPrefix() string {
+	if i := strings.Index(auto_storage_class_prefix, "%"); i >= 0 {
+		return auto_storage_class_prefix[:i]
+	}
+	return auto_storage_class_prefix
+}
+
+// ReconcileResult summarizes what reconcileAutoStorageClasses changed.
+type ReconcileResult struct {
+	Updated []string
+	Removed []string
+}
+
+// reconcileAutoStorageClasses enumerates every auto-created storage class
+// (named with auto_storage_class_prefix) that was pinned to a specific
+// aggregate/pool via the "aggregate|pool" option, and re-derives which
+// backend/pool pairs currently satisfy that pin by pool name, as
+// makeStorageClass did at creation time, but across every backend rather
+// than only the first match. If the pin now matches a different or additional set
+// of pools (an aggregate moved, or was added to another backend), the
+// storage class's Pools mapping is updated in place. If no backend
+// advertises the pinned pool any longer, the storage class is removed as
+// stale; the next matching volume-create request re-hashes and recreates it.
+// Storage classes that only carry generic attributes (no pinned pool) are
+// matched against backend pools dynamically at provisioning time and need no
+// reconciliation here.
+//
+// This runs once per volume-create request, from getStorageClass, rather
+// than on plugin startup or through any orchestrator-level API: nothing in
+// this package's scope observes plugin startup, and every storage class this
+// function might need to fix is one this frontend itself auto-created, so
+// the first request after a drift is always enough to catch it. It never
+// creates storage classes (that stays makeStorageClass's job at match time),
+// so there is no "Added" outcome to report.
+func reconcileAutoStorageClasses(o core.Orchestrator) ReconcileResult {
+
+	result := ReconcileResult{}
+	prefix := autoStorageClassPrefix()
+
+	for _, sc := range o.ListStorageClasses() {
+		if !strings.HasPrefix(sc.Config.Name, prefix) {
+			continue
+		}
+		if len(sc.Config.Pools) == 0 {
+			continue
+		}
+
+		pools := matchingPools(o, sc.Config.Pools)
+
+		if len(pools) == 0 {
+			if err := o.DeleteStorageClass(sc.Config.Name); err != nil {
+				log.Error("Docker frontend couldn't remove stale storage class: ", err)
+				continue
+			}
+			result.Removed = append(result.Removed, sc.Config.Name)
+			continue
+		}
+
+		if !poolsEqual(sc.Config.Pools, pools) {
+			sc.Config.Pools = pools
+			if _, err := o.UpdateStorageClass(sc.Config); err != nil {
+				log.Error("Docker frontend couldn't update storage class pools: ", err)
+				continue
+			}
+			result.Updated = append(result.Updated, sc.Config.Name)
+		}
+	}
+
+	if len(result.Updated) > 0 || len(result.Removed) > 0 {
+		log.WithFields(log.Fields{
+			"updated": result.Updated,
+			"removed": result.Removed,
+		}).Info("Docker frontend reconciled auto-created storage classes.")
+	}
+
+	return result
+}
+
+// matchingPools re-derives which backend/pool pairs currently satisfy the
+// pool names referenced in want, matching pool names as makeStorageClass's
+// aggrLoop does at creation time but collecting every backend that
+// advertises a wanted pool rather than stopping at the first, so a pool that
+// moved to (or was added on) another backend is picked back up instead of
+// leaving the storage class orphaned.
+func matchingPools(o core.Orchestrator, want map[string][]string) map[string][]string {
+	wantedNames := make(map[string]bool)
+	for _, names := range want {
+		for _, name := range names {
+			wantedNames[name] = true
+		}
+	}
+
+	found := make(map[string][]string)
+	for _, backend := range o.ListBackends() {
+		for poolName := range backend.Storage {
+			if wantedNames[poolName] {
+				found[backend.Name] = append(found[backend.Name], poolName)
+			}
+		}
+	}
+	return found
+}
+
+// poolsEqual reports whether a and b name the same backend/pool pairs,
+// ignoring slice order.
+func poolsEqual(a, b map[string][]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for backend, namesA := range a {
+		namesB, ok := b[backend]
+		if !ok || len(namesA) != len(namesB) {
+			return false
+		}
+		setA := make(map[string]bool, len(namesA))
+		for _, n := range namesA {
+			setA[n] = true
+		}
+		for _, n := range namesB {
+			if !setA[n] {
+				return false
+			}
+		}
+	}
+	return true
+}
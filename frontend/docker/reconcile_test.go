@@ -0,0 +1,42 @@
+package docker
+
+import "testing"
+
+func TestPoolsEqual(t *testing.T) {
+	cases := []struct {
+		name string
+		a, b map[string][]string
+		want bool
+	}{
+		{
+			name: "identical",
+			a:    map[string][]string{"backend1": {"aggr1"}},
+			b:    map[string][]string{"backend1": {"aggr1"}},
+			want: true,
+		},
+		{
+			name: "different order",
+			a:    map[string][]string{"backend1": {"aggr1", "aggr2"}},
+			b:    map[string][]string{"backend1": {"aggr2", "aggr1"}},
+			want: true,
+		},
+		{
+			name: "pool moved to another backend",
+			a:    map[string][]string{"backend1": {"aggr1"}},
+			b:    map[string][]string{"backend2": {"aggr1"}},
+			want: false,
+		},
+		{
+			name: "pool removed",
+			a:    map[string][]string{"backend1": {"aggr1"}},
+			b:    map[string][]string{},
+			want: false,
+		},
+	}
+
+	for _, c := range cases {
+		if got := poolsEqual(c.a, c.b); got != c.want {
+			t.Errorf("%s: poolsEqual(%v, %v) = %v, want %v", c.name, c.a, c.b, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package docker
+
+import (
+	"fmt"
+
+	"github.com/netapp/trident/core"
+	"github.com/netapp/trident/snapshot_class"
+)
+
+// snapshotClassOptions is the parsed form of the opts a Docker volume-create
+// request carries when it is actually asking to register a reusable
+// snapshot-policy bundle rather than provision a volume.
+type snapshotClassOptions struct {
+	Name              string
+	RetentionSchedule string
+	PreHook           string
+	PostHook          string
+	ConsistencyGroup  string
+}
+
+// parseSnapshotClassOptions extracts a snapshotClassOptions from opts, or
+// returns ok=false if opts doesn't ask to create a snapshot class at all.
+func parseSnapshotClassOptions(opts map[string]string) (options *snapshotClassOptions, ok bool) {
+	name := opts["createSnapshotClass"]
+	if name == "" {
+		return nil, false
+	}
+
+	return &snapshotClassOptions{
+		Name:              name,
+		RetentionSchedule: opts["retentionSchedule"],
+		PreHook:           opts["preHook"],
+		PostHook:          opts["postHook"],
+		ConsistencyGroup:  opts["consistencyGroup"],
+	}, true
+}
+
+// handleSnapshotClassOption inspects a Docker volume-create request's opts
+// for the createSnapshotClass key and, if present, registers a new
+// snapshot class with the orchestrator instead of provisioning the requested
+// volume as an ordinary volume.  It returns true if opts requested a
+// snapshot class registration.  This is the Docker frontend's only lever for creating
+// objects outside of "docker volume create", the same pattern
+// handleBackupOption uses for backup/restore.
+func handleSnapshotClassOption(o core.Orchestrator, opts map[string]string) (bool, error) {
+
+	options, ok := parseSnapshotClassOptions(opts)
+	if !ok {
+		return false, nil
+	}
+
+	scConfig := &snapshot_class.Config{
+		Name:              options.Name,
+		RetentionSchedule: options.RetentionSchedule,
+		PreHook:           options.PreHook,
+		PostHook:          options.PostHook,
+		ConsistencyGroup:  options.ConsistencyGroup,
+	}
+
+	if _, err := o.AddSnapshotClass(scConfig); err != nil {
+		return true, fmt.Errorf("error registering snapshotClass %s: %v", options.Name, err)
+	}
+
+	return true, nil
+}
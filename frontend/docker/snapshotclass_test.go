@@ -0,0 +1,39 @@
+package docker
+
+import "testing"
+
+func TestParseSnapshotClassOptionsAbsent(t *testing.T) {
+	if _, ok := parseSnapshotClassOptions(map[string]string{}); ok {
+		t.Error("expected ok=false when createSnapshotClass is not set")
+	}
+}
+
+func TestParseSnapshotClassOptionsPresent(t *testing.T) {
+	opts := map[string]string{
+		"createSnapshotClass": "gold",
+		"retentionSchedule":   "daily:7",
+		"preHook":             "/sbin/freeze.sh",
+		"postHook":            "/sbin/thaw.sh",
+		"consistencyGroup":    "app-cg",
+	}
+
+	options, ok := parseSnapshotClassOptions(opts)
+	if !ok {
+		t.Fatal("expected ok=true when createSnapshotClass is set")
+	}
+	if options.Name != "gold" {
+		t.Errorf("Name = %q, want %q", options.Name, "gold")
+	}
+	if options.RetentionSchedule != "daily:7" {
+		t.Errorf("RetentionSchedule = %q, want %q", options.RetentionSchedule, "daily:7")
+	}
+	if options.PreHook != "/sbin/freeze.sh" {
+		t.Errorf("PreHook = %q, want %q", options.PreHook, "/sbin/freeze.sh")
+	}
+	if options.PostHook != "/sbin/thaw.sh" {
+		t.Errorf("PostHook = %q, want %q", options.PostHook, "/sbin/thaw.sh")
+	}
+	if options.ConsistencyGroup != "app-cg" {
+		t.Errorf("ConsistencyGroup = %q, want %q", options.ConsistencyGroup, "app-cg")
+	}
+}
@@ -14,12 +14,70 @@ import (
 	"github.com/netapp/trident/storage_class"
 )
 
+// validCloneStrategies enumerates the clone strategies a Docker volume-create
+// request may select via the cloneStrategy option.  These mirror the ways a
+// backend can satisfy CloneSourceVolume/CloneSourceSnapshot: take a transient
+// snapshot and clone from it, stream a full copy of the data, or invoke the
+// backend's native clone primitive directly.
+var validCloneStrategies = map[string]bool{
+	"snapshot":  true,
+	"copy":      true,
+	"csi-clone": true,
+}
+
+// validateCloneStrategy returns an error if cloneStrategy is set to
+// anything other than one of validCloneStrategies.  An empty string is
+// valid; it means the caller let the backend pick its default.
+func validateCloneStrategy(cloneStrategy string) error {
+	if cloneStrategy != "" && !validCloneStrategies[cloneStrategy] {
+		return fmt.Errorf("unsupported cloneStrategy: %s", cloneStrategy)
+	}
+	return nil
+}
+
+// createVolume is the Docker frontend's volume-create entry point. It first
+// gives opts a chance to request a backup/restore operation or a
+// snapshotClass registration instead of an ordinary create; only once both
+// are ruled out does it derive a storage class from opts and provision name
+// as a plain volume.
+func createVolume(o core.Orchestrator, name string, opts map[string]string) (*storage.VolumeConfig, error) {
+
+	if handled, err := handleBackupOption(o, name, opts); handled {
+		return nil, err
+	}
+
+	if handled, err := handleSnapshotClassOption(o, opts); handled {
+		return nil, err
+	}
+
+	scConfig, err := getStorageClass(opts, o)
+	if err != nil {
+		return nil, err
+	}
+
+	volumeConfig, err := getVolumeConfig(name, scConfig.Name, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	vol, err := o.AddVolume(volumeConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return vol.Config, nil
+}
+
 // getStorageClass accepts a list of volume creation options and returns a
 // matching storage class.  If the orchestrator already has a matching
 // storage class, that is returned; otherwise a new one is created and
 // registered with the orchestrator.
 func getStorageClass(options map[string]string, o core.Orchestrator) (*storage_class.Config, error) {
 
+	// Bring auto-created storage classes up to date with what their backends
+	// currently advertise before matching against them.
+	reconcileAutoStorageClasses(o)
+
 	// Create a storage class based on available options
 	newScConfig, err := makeStorageClass(options, o)
 	if err != nil {
@@ -68,6 +126,20 @@ func makeStorageClass(options map[string]string, o core.Orchestrator) (*storage_
 		}
 	}
 
+	// Map cloneStrategy option to a storage class attribute so that, at
+	// match time, only pools whose backend advertises support for the
+	// requested clone strategy are considered.  The option only means
+	// anything alongside an actual clone source, so a stray cloneStrategy on
+	// an ordinary (non-clone) create is ignored rather than needlessly
+	// restricting pool matching.
+	cloneStrategy := ""
+	if dvp_utils.GetV(options, "from", "") != "" || dvp_utils.GetV(options, "fromSnapshot", "") != "" {
+		cloneStrategy = dvp_utils.GetV(options, "cloneStrategy", "")
+		if err := validateCloneStrategy(cloneStrategy); err != nil {
+			return nil, err
+		}
+	}
+
 	// Map remaining options to storage class attributes
 	scConfig.Attributes = make(map[string]storage_attribute.Request)
 	for k, v := range options {
@@ -83,6 +155,30 @@ func makeStorageClass(options map[string]string, o core.Orchestrator) (*storage_
 		scConfig.Attributes[k] = req
 	}
 
+	if cloneStrategy != "" {
+		req, err := storage_attribute.CreateAttributeRequestFromAttributeValue(
+			"cloneStrategy", fmt.Sprintf("string:%s", cloneStrategy))
+		if err != nil {
+			log.WithFields(log.Fields{
+				"storageClass":  scConfig.Name,
+				"cloneStrategy": cloneStrategy,
+			}).Error("Docker frontend couldn't build the cloneStrategy attribute: ", err)
+			return nil, err
+		}
+		scConfig.Attributes["cloneStrategy"] = req
+	}
+
+	// The snapshot class names a reusable snapshot-policy bundle registered
+	// separately with the orchestrator via AddSnapshotClass.  It must refer
+	// to one that actually exists, and is folded into the hash so that two
+	// storage classes differing only in snapshot policy don't collide on the
+	// same auto-generated name.
+	snapshotClass := dvp_utils.GetV(options, "snapshotClass", "")
+	if snapshotClass != "" && o.GetSnapshotClass(snapshotClass) == nil {
+		return nil, fmt.Errorf("unknown snapshotClass: %s", snapshotClass)
+	}
+	scConfig.SnapshotClass = snapshotClass
+
 	// Set name based on hash value
 	scHash, err := hash.Hash(scConfig, nil)
 	if err != nil {
@@ -107,6 +203,18 @@ func getVolumeConfig(name, storageClass string, opts map[string]string) (*storag
 	}
 	delete(opts, "size")
 
+	cloneSourceVolume := dvp_utils.GetV(opts, "from", "")
+	cloneSourceSnapshot := dvp_utils.GetV(opts, "fromSnapshot", "")
+
+	// cloneStrategy only has meaning alongside an actual clone source.
+	cloneStrategy := ""
+	if cloneSourceVolume != "" || cloneSourceSnapshot != "" {
+		cloneStrategy = dvp_utils.GetV(opts, "cloneStrategy", "")
+		if err := validateCloneStrategy(cloneStrategy); err != nil {
+			return nil, err
+		}
+	}
+
 	return &storage.VolumeConfig{
 		Name:                name,
 		Size:                fmt.Sprintf("%d", sizeBytes),
@@ -123,7 +231,13 @@ func getVolumeConfig(name, storageClass string, opts map[string]string) (*storag
 		BlockSize:           dvp_utils.GetV(opts, "blocksize", ""),
 		FileSystem:          dvp_utils.GetV(opts, "fstype|fileSystemType", ""),
 		Encryption:          dvp_utils.GetV(opts, "encryption", ""),
-		CloneSourceVolume:   dvp_utils.GetV(opts, "from", ""),
-		CloneSourceSnapshot: dvp_utils.GetV(opts, "fromSnapshot", ""),
+		CloneSourceVolume:   cloneSourceVolume,
+		CloneSourceSnapshot: cloneSourceSnapshot,
+		CloneStrategy:       cloneStrategy,
+		// SnapshotClass names a reusable snapshot-policy bundle (retention
+		// schedule, pre/post hooks, consistency group membership) that the
+		// backend driver translates into its vendor-specific schedule
+		// configuration, separately from the SnapshotPolicy string above.
+		SnapshotClass: dvp_utils.GetV(opts, "snapshotClass", ""),
 	}, nil
 }
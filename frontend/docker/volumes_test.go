@@ -0,0 +1,51 @@
+package docker
+
+import "testing"
+
+func TestValidateCloneStrategy(t *testing.T) {
+	cases := []struct {
+		cloneStrategy string
+		wantErr       bool
+	}{
+		{"", false},
+		{"snapshot", false},
+		{"copy", false},
+		{"csi-clone", false},
+		{"bogus", true},
+	}
+
+	for _, c := range cases {
+		err := validateCloneStrategy(c.cloneStrategy)
+		if c.wantErr && err == nil {
+			t.Errorf("validateCloneStrategy(%q): expected an error, got nil", c.cloneStrategy)
+		}
+		if !c.wantErr && err != nil {
+			t.Errorf("validateCloneStrategy(%q): unexpected error: %v", c.cloneStrategy, err)
+		}
+	}
+}
+
+func TestGetVolumeConfigIgnoresCloneStrategyWithoutCloneSource(t *testing.T) {
+	opts := map[string]string{
+		"cloneStrategy": "bogus-strategy-that-would-fail-validation",
+	}
+
+	volumeConfig, err := getVolumeConfig("testvol", "testsc", opts)
+	if err != nil {
+		t.Fatalf("expected no error for a non-clone create with a stray cloneStrategy, got: %v", err)
+	}
+	if volumeConfig.CloneStrategy != "" {
+		t.Errorf("expected CloneStrategy to be ignored without a clone source, got %q", volumeConfig.CloneStrategy)
+	}
+}
+
+func TestGetVolumeConfigValidatesCloneStrategyWithCloneSource(t *testing.T) {
+	opts := map[string]string{
+		"from":          "sourcevol",
+		"cloneStrategy": "bogus",
+	}
+
+	if _, err := getVolumeConfig("testvol", "testsc", opts); err == nil {
+		t.Error("expected an error for an invalid cloneStrategy on a clone create")
+	}
+}